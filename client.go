@@ -0,0 +1,280 @@
+package nakadi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultInitialRetryInterval = 20 * time.Millisecond
+	defaultMaxRetryInterval     = 5 * time.Second
+	defaultMaxElapsedTime       = 5 * time.Minute
+)
+
+// problemJSON mirrors the application/problem+json payload Nakadi returns on errors.
+type problemJSON struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// TokenProvider supplies a valid OAuth2 bearer token for each outgoing request.
+type TokenProvider func() (string, error)
+
+// ClientOptions is a set of optional parameters used to configure a Client.
+type ClientOptions struct {
+	// TokenProvider is consulted for every request and, if set, its result is sent as a
+	// Bearer token in the Authorization header.
+	TokenProvider TokenProvider
+	// HTTPClient is the http.Client used to perform requests. Defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func (o *ClientOptions) withDefaults() *ClientOptions {
+	var copyOptions ClientOptions
+	if o != nil {
+		copyOptions = *o
+	}
+	if copyOptions.HTTPClient == nil {
+		copyOptions.HTTPClient = http.DefaultClient
+	}
+	return &copyOptions
+}
+
+// NewClient creates a new Client that talks to the Nakadi instance reachable at url.
+// The last parameter is a struct containing only optional parameters. The options may
+// be nil.
+func NewClient(url string, options *ClientOptions) *Client {
+	options = options.withDefaults()
+	return &Client{
+		nakadiURL:     url,
+		tokenProvider: options.TokenProvider,
+		httpClient:    options.HTTPClient}
+}
+
+// Client is the low level HTTP client shared by the sub APIs of this package. It owns
+// request construction, authentication, and the retry loop that EventAPI's
+// httpGET/POST/PUT/DELETE calls go through.
+type Client struct {
+	nakadiURL     string
+	tokenProvider TokenProvider
+	httpClient    *http.Client
+}
+
+// backoffConfig holds the parameters needed to build a fresh backoff.BackOff for a
+// single request. An ExponentialBackOff is stateful (it tracks the current interval
+// and elapsed time) and is not safe for concurrent use, so every sub API stores a
+// backoffConfig rather than a shared backoff.BackOff and builds a new instance inside
+// retryPolicy() for each call.
+type backoffConfig struct {
+	retry      bool
+	initial    time.Duration
+	max        time.Duration
+	maxElapsed time.Duration
+}
+
+// new builds the exponential backoff.BackOff for one request: a no-op
+// backoff.StopBackOff when retry is disabled, or a freshly configured exponential
+// backoff otherwise.
+func (c backoffConfig) new() backoff.BackOff {
+	if !c.retry {
+		return &backoff.StopBackOff{}
+	}
+	back := backoff.NewExponentialBackOff()
+	back.InitialInterval = c.initial
+	back.MaxInterval = c.max
+	back.MaxElapsedTime = c.maxElapsed
+	return back
+}
+
+// isRetryableStatus reports whether a response with this status code should be
+// retried: Nakadi may be temporarily overloaded (429, 503) or briefly unavailable
+// (other 5xx).
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// do performs a single logical request, retrying according to policy until it
+// succeeds, a non retryable status is returned, or the backoff is exhausted. On 429 or
+// 503 responses it honors a Retry-After header (capped by policy.retryAfterMax) for
+// that one retry instead of the regular exponential interval.
+func (c *Client) do(ctx context.Context, method, url string, policy *retryPolicy, body []byte, contentType string) (*http.Response, error) {
+	backOff := backoff.WithContext(policy.backOff, ctx)
+	backOff.Reset()
+
+	start := time.Now()
+	attempt := 0
+	lastStatus := 0
+
+	for {
+		attempt++
+
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		request, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create request")
+		}
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		if err := c.authorize(request); err != nil {
+			return nil, errors.Wrap(err, "unable to authorize request")
+		}
+
+		response, err := c.httpClient.Do(request)
+
+		var lastErr error
+		var statusCode int
+		var retryAfter string
+		switch {
+		case err != nil:
+			lastErr = err
+		case isRetryableStatus(response.StatusCode):
+			statusCode = response.StatusCode
+			retryAfter = response.Header.Get("Retry-After")
+			lastErr = errors.Wrapf(problemDetail(response), "request failed with status %d", response.StatusCode)
+			response.Body.Close()
+		default:
+			if policy.stats != nil {
+				policy.stats.recordStatus(response.StatusCode)
+			}
+			return response, nil
+		}
+
+		if statusCode != 0 {
+			lastStatus = statusCode
+			if policy.stats != nil {
+				policy.stats.recordStatus(statusCode)
+			}
+		}
+
+		next := backOff.NextBackOff()
+		if next == backoff.Stop {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, &RetryError{Attempts: attempt, Elapsed: time.Since(start), StatusCode: lastStatus, Err: lastErr}
+		}
+
+		if policy.retryAfterMax != 0 && (statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable) {
+			if d, ok := parseRetryAfter(retryAfter, policy.retryAfterMax); ok {
+				next = d
+			}
+		}
+
+		if policy.stats != nil {
+			policy.stats.recordRetry()
+		}
+		if policy.onRetry != nil {
+			policy.onRetry(attempt, time.Since(start), lastErr, next)
+		}
+
+		timer := time.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) authorize(request *http.Request) error {
+	if c.tokenProvider == nil {
+		return nil
+	}
+	token, err := c.tokenProvider()
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// httpGET performs a GET request and decodes a successful (200) JSON response into out.
+func (c *Client) httpGET(ctx context.Context, policy *retryPolicy, url string, out interface{}, errMsg string) error {
+	response, err := c.do(ctx, http.MethodGet, url, policy, nil, "")
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return decodeProblem(response, errMsg)
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return errors.Wrap(err, "unable to decode response body")
+	}
+	return nil
+}
+
+// httpPOST performs a POST request with body encoded as JSON. The caller is
+// responsible for inspecting the response status and closing its body.
+func (c *Client) httpPOST(ctx context.Context, policy *retryPolicy, url string, body interface{}) (*http.Response, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode request body")
+	}
+	return c.do(ctx, http.MethodPost, url, policy, encoded, "application/json")
+}
+
+// httpPUT performs a PUT request with body encoded as JSON. The caller is responsible
+// for inspecting the response status and closing its body.
+func (c *Client) httpPUT(ctx context.Context, policy *retryPolicy, url string, body interface{}) (*http.Response, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode request body")
+	}
+	return c.do(ctx, http.MethodPut, url, policy, encoded, "application/json")
+}
+
+// httpDELETE performs a DELETE request and treats any of 200, 202, or 204 as success.
+func (c *Client) httpDELETE(ctx context.Context, policy *retryPolicy, url string, errMsg string) error {
+	response, err := c.do(ctx, http.MethodDelete, url, policy, nil, "")
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+		return nil
+	default:
+		return decodeProblem(response, errMsg)
+	}
+}
+
+// decodeProblem reads an application/problem+json error body and turns it into an
+// error prefixed with errMsg.
+func decodeProblem(response *http.Response, errMsg string) error {
+	problem := problemJSON{}
+	if err := json.NewDecoder(response.Body).Decode(&problem); err != nil {
+		return errors.Wrap(err, "unable to decode response body")
+	}
+	return errors.Errorf("%s: %s", errMsg, problem.Detail)
+}
+
+// problemDetail reads a retryable response's application/problem+json body without
+// consuming the status handling in do: it is used to preserve Nakadi's problem detail
+// on a RetryError even though the response itself is discarded after a retryable
+// status is observed. It falls back to a generic message if the body is absent or not
+// valid JSON, which is the common case for a 503 from a plain load balancer.
+func problemDetail(response *http.Response) error {
+	problem := problemJSON{}
+	if err := json.NewDecoder(response.Body).Decode(&problem); err != nil || problem.Detail == "" {
+		return errors.New("no further detail in response body")
+	}
+	return errors.New(problem.Detail)
+}
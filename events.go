@@ -1,15 +1,25 @@
 package nakadi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/backoff"
 	"github.com/pkg/errors"
 )
 
+// RetryAfterAlways is a sentinel value for EventOptions.RetryAfterMax that tells the
+// client to always honor a Retry-After header returned by Nakadi, regardless of how
+// long the delay is.
+const RetryAfterAlways time.Duration = -1
+
 // An EventType defines a kind of event that can be processed on a Nakadi service.
 type EventType struct {
 	Name                 string               `json:"name"`
@@ -65,6 +75,27 @@ type EventOptions struct {
 	// Once this value was reached the exponential backoff is halted and the request will
 	// fail with an error.
 	MaxElapsedTime time.Duration
+	// RetryAfterMax caps how long the client will sleep when Nakadi responds with a
+	// Retry-After header on a 429 (Too Many Requests) or 503 (Service Unavailable). The
+	// server-supplied delay overrides the exponential interval for that one attempt, but
+	// still counts against MaxElapsedTime. A value of 0 (the default) ignores the header
+	// entirely and falls back to the regular exponential backoff. Use RetryAfterAlways to
+	// honor the header no matter how long the requested delay is. Malformed Retry-After
+	// values are ignored and the normal backoff applies.
+	RetryAfterMax time.Duration
+	// ValidateSchema enables local JSON Schema validation of events. When set, every
+	// event type returned by Get/List has its Schema compiled (using Validator) and
+	// cached, so that EventAPI.Validate and the publish path can check payloads against
+	// it without another round trip to Nakadi (default: false).
+	ValidateSchema bool
+	// Validator compiles the JSON Schema carried by an EventTypeSchema. It is pluggable
+	// so callers can inject whichever JSON Schema implementation they prefer (e.g.
+	// gojsonschema or santhosh-tekuri/jsonschema). Required when ValidateSchema is true.
+	Validator SchemaValidator
+	// OnRetry, if set, is invoked before every retry attempt performed by the
+	// exponential backoff, after a request has failed. It is useful for logging or
+	// emitting metrics and must not block for long, since it runs on the retry loop.
+	OnRetry func(attempt int, elapsed time.Duration, err error, nextInterval time.Duration)
 }
 
 func (o *EventOptions) withDefaults() *EventOptions {
@@ -90,50 +121,316 @@ func (o *EventOptions) withDefaults() *EventOptions {
 func NewEventAPI(client *Client, options *EventOptions) *EventAPI {
 	options = options.withDefaults()
 
-	var backOff backoff.BackOff
-	if options.Retry {
-		back := backoff.NewExponentialBackOff()
-		back.InitialInterval = options.InitialRetryInterval
-		back.MaxInterval = options.MaxRetryInterval
-		back.MaxElapsedTime = options.MaxElapsedTime
-		backOff = back
-	} else {
-		backOff = &backoff.StopBackOff{}
-	}
+	backOff := backoffConfig{
+		retry:      options.Retry,
+		initial:    options.InitialRetryInterval,
+		max:        options.MaxRetryInterval,
+		maxElapsed: options.MaxElapsedTime}
 	return &EventAPI{
-		client:  client,
-		backOff: backOff}
+		client:         client,
+		backOff:        backOff,
+		retryAfterMax:  options.RetryAfterMax,
+		validateSchema: options.ValidateSchema,
+		validator:      options.Validator,
+		schemaCache:    map[string]CompiledSchema{},
+		latestVersion:  map[string]string{},
+		onRetry:        options.OnRetry,
+		stats:          &apiStats{byStatus: map[int]int64{}}}
 }
 
 // EventAPI is a sub API that allows to inspect and manage event types on a Nakadi instance.
 type EventAPI struct {
-	client  *Client
-	backOff backoff.BackOff
+	client         *Client
+	backOff        backoffConfig
+	retryAfterMax  time.Duration
+	validateSchema bool
+	validator      SchemaValidator
+	schemaMu       sync.RWMutex
+	schemaCache    map[string]CompiledSchema
+	latestVersion  map[string]string
+	onRetry        func(attempt int, elapsed time.Duration, err error, nextInterval time.Duration)
+	stats          *apiStats
+}
+
+// apiStats accumulates the counters backing EventAPI.Stats. It is shared with the
+// retryPolicy handed down to Client so the retry loop can update it directly.
+type apiStats struct {
+	totalRequests int64
+	totalRetries  int64
+	statusMu      sync.Mutex
+	byStatus      map[int]int64
+}
+
+func (s *apiStats) recordRequest() {
+	atomic.AddInt64(&s.totalRequests, 1)
+}
+
+func (s *apiStats) recordRetry() {
+	atomic.AddInt64(&s.totalRetries, 1)
+}
+
+func (s *apiStats) recordStatus(code int) {
+	s.statusMu.Lock()
+	s.byStatus[code]++
+	s.statusMu.Unlock()
+}
+
+func (s *apiStats) snapshot() Stats {
+	s.statusMu.Lock()
+	byStatus := make(map[int]int64, len(s.byStatus))
+	for code, count := range s.byStatus {
+		byStatus[code] = count
+	}
+	s.statusMu.Unlock()
+	return Stats{
+		TotalRequests: atomic.LoadInt64(&s.totalRequests),
+		TotalRetries:  atomic.LoadInt64(&s.totalRetries),
+		ByStatusCode:  byStatus}
+}
+
+// Stats is a point-in-time snapshot of retry and request counters, suitable for
+// exposing via Prometheus or similar.
+type Stats struct {
+	TotalRequests int64
+	TotalRetries  int64
+	ByStatusCode  map[int]int64
+}
+
+// Stats returns the current request and retry counters for this EventAPI.
+func (e *EventAPI) Stats() Stats {
+	return e.stats.snapshot()
+}
+
+// RetryError wraps the final error of a request whose last attempt failed with a
+// transport error or a retryable status and that was not retried further, including a
+// request that failed on its first attempt (Attempts is then 1). It records how many
+// attempts were made, how much time elapsed, and the last HTTP status code observed
+// (0 if the request never received a response).
+type RetryError struct {
+	Attempts   int
+	Elapsed    time.Duration
+	StatusCode int
+	Err        error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("request failed after %d attempts (%s): %s", e.Attempts, e.Elapsed, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// SchemaValidator compiles a JSON Schema string into a reusable CompiledSchema. It
+// lets callers plug in whichever JSON Schema library they prefer.
+type SchemaValidator interface {
+	Compile(schema string) (CompiledSchema, error)
+}
+
+// CompiledSchema validates an event payload against a previously compiled JSON Schema.
+type CompiledSchema interface {
+	// Validate checks payload against the compiled schema. It returns the JSON
+	// Pointer path of every field that failed validation, or nil if payload is
+	// valid.
+	Validate(payload interface{}) []string
+}
+
+// ValidationError is returned by EventAPI.Validate (and, by extension, PublishAPI.Publish
+// once schema validation is enabled) when a payload fails JSON Schema validation. Paths
+// follow JSON Pointer notation relative to the payload root.
+type ValidationError struct {
+	EventType string
+	Paths     []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("event failed schema validation for event type %s: %s", e.EventType, strings.Join(e.Paths, "; "))
+}
+
+// schemaCacheKey identifies a compiled schema by event type name and schema version,
+// since Nakadi allows an event type's schema to evolve across versions.
+func schemaCacheKey(eventTypeName, version string) string {
+	return eventTypeName + "@" + version
+}
+
+// cacheSchema compiles and caches the schema of eventType, replacing any previously
+// cached entry for the same name and version. It is a no-op when schema validation is
+// not enabled.
+func (e *EventAPI) cacheSchema(eventType *EventType) error {
+	if !e.validateSchema || e.validator == nil || eventType.Schema == nil {
+		return nil
+	}
+	compiled, err := e.validator.Compile(eventType.Schema.Schema)
+	if err != nil {
+		return errors.Wrapf(err, "unable to compile schema for event type %s", eventType.Name)
+	}
+	e.schemaMu.Lock()
+	e.schemaCache[schemaCacheKey(eventType.Name, eventType.Schema.Version)] = compiled
+	e.latestVersion[eventType.Name] = eventType.Schema.Version
+	e.schemaMu.Unlock()
+	return nil
+}
+
+// validateSchemaString rejects obviously broken schemas before they are sent to
+// Nakadi: the schema must at least be syntactically valid JSON, and, when a validator
+// is configured, it must compile.
+func (e *EventAPI) validateSchemaString(eventType *EventType) error {
+	if eventType.Schema == nil {
+		return nil
+	}
+	if !json.Valid([]byte(eventType.Schema.Schema)) {
+		return errors.Errorf("schema for event type %s is not valid JSON", eventType.Name)
+	}
+	if e.validator == nil {
+		return nil
+	}
+	if _, err := e.validator.Compile(eventType.Schema.Schema); err != nil {
+		return errors.Wrapf(err, "schema for event type %s does not compile", eventType.Name)
+	}
+	return nil
+}
+
+// Validate checks payload against the cached, compiled JSON Schema of the event type
+// eventTypeName. The schema is cached as a side effect of Get/GetContext or
+// List/ListContext; callers must fetch the event type at least once (with
+// EventOptions.ValidateSchema enabled) before calling Validate. It returns a
+// *ValidationError when the payload does not conform to the schema.
+func (e *EventAPI) Validate(eventTypeName string, payload interface{}) error {
+	if !e.validateSchema || e.validator == nil {
+		return nil
+	}
+
+	e.schemaMu.RLock()
+	version, ok := e.latestVersion[eventTypeName]
+	var compiled CompiledSchema
+	if ok {
+		compiled = e.schemaCache[schemaCacheKey(eventTypeName, version)]
+	}
+	e.schemaMu.RUnlock()
+
+	if compiled == nil {
+		return errors.Errorf("no compiled schema cached for event type %s", eventTypeName)
+	}
+
+	if paths := compiled.Validate(payload); len(paths) > 0 {
+		return &ValidationError{EventType: eventTypeName, Paths: paths}
+	}
+	return nil
+}
+
+// retryPolicy bundles a backoff strategy together with the upper bound used for
+// honoring a Retry-After header. It is shared by the sub APIs of this package
+// (EventAPI, PublishAPI) that retry requests through Client.httpGET/POST/PUT/DELETE.
+type retryPolicy struct {
+	backOff       backoff.BackOff
+	retryAfterMax time.Duration
+	onRetry       func(attempt int, elapsed time.Duration, err error, nextInterval time.Duration)
+	stats         *apiStats
+}
+
+// retryPolicy returns the retry policy used for requests issued by this EventAPI. It
+// also records the request against Stats().
+func (e *EventAPI) retryPolicy() *retryPolicy {
+	e.stats.recordRequest()
+	return &retryPolicy{
+		backOff:       e.backOff.new(),
+		retryAfterMax: e.retryAfterMax,
+		onRetry:       e.onRetry,
+		stats:         e.stats}
+}
+
+// parseRetryAfter parses the value of a Retry-After header as defined by RFC 7231
+// (either delta-seconds or an HTTP-date) and caps it at max. A negative max of
+// RetryAfterAlways leaves the parsed duration uncapped. It reports ok == false if the
+// header is empty or malformed, in which case callers should fall back to the regular
+// exponential backoff.
+func parseRetryAfter(header string, max time.Duration) (d time.Duration, ok bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		d = time.Until(date)
+	} else {
+		return 0, false
+	}
+
+	if d < 0 {
+		return 0, false
+	}
+	if max != RetryAfterAlways && d > max {
+		d = max
+	}
+	return d, true
 }
 
 // List returns all registered event types.
 func (e *EventAPI) List() ([]*EventType, error) {
+	return e.ListContext(context.Background())
+}
+
+// ListContext returns all registered event types. Provided context is used for
+// cancellation and may abort a request, or the retry sequence around it, while it is
+// in flight. When ValidateSchema is enabled, a schema that fails to compile for one
+// event type does not fail the whole call: the returned slice still contains every
+// event type Nakadi reported, and the error describes which schemas could not be
+// cached.
+func (e *EventAPI) ListContext(ctx context.Context) ([]*EventType, error) {
 	eventTypes := []*EventType{}
-	err := e.client.httpGET(e.backOff, e.eventBaseURL(), &eventTypes, "unable to request event types")
+	err := e.client.httpGET(ctx, e.retryPolicy(), e.eventBaseURL(), &eventTypes, "unable to request event types")
 	if err != nil {
 		return nil, err
 	}
+
+	var schemaErrs []string
+	for _, eventType := range eventTypes {
+		if err := e.cacheSchema(eventType); err != nil {
+			schemaErrs = append(schemaErrs, err.Error())
+		}
+	}
+	if len(schemaErrs) > 0 {
+		return eventTypes, errors.Errorf("unable to cache schema for %d event type(s): %s", len(schemaErrs), strings.Join(schemaErrs, "; "))
+	}
 	return eventTypes, nil
 }
 
 // Get returns an event type based on its name.
 func (e *EventAPI) Get(name string) (*EventType, error) {
+	return e.GetContext(context.Background(), name)
+}
+
+// GetContext returns an event type based on its name. Provided context is used for
+// cancellation and may abort a request, or the retry sequence around it, while it is
+// in flight. When ValidateSchema is enabled, a schema that fails to compile does not
+// fail the call: the event type Nakadi returned is still returned alongside the error
+// describing why its schema could not be cached, mirroring ListContext.
+func (e *EventAPI) GetContext(ctx context.Context, name string) (*EventType, error) {
 	eventType := &EventType{}
-	err := e.client.httpGET(e.backOff, e.eventURL(name), eventType, "unable to request event types")
+	err := e.client.httpGET(ctx, e.retryPolicy(), e.eventURL(name), eventType, "unable to request event types")
 	if err != nil {
 		return nil, err
 	}
+	if err := e.cacheSchema(eventType); err != nil {
+		return eventType, err
+	}
 	return eventType, nil
 }
 
 // Create saves a new event type.
 func (e *EventAPI) Create(eventType *EventType) error {
-	response, err := e.client.httpPOST(e.backOff, e.eventBaseURL(), eventType)
+	return e.CreateContext(context.Background(), eventType)
+}
+
+// CreateContext saves a new event type. Provided context is used for cancellation and
+// may abort a request, or the retry sequence around it, while it is in flight.
+func (e *EventAPI) CreateContext(ctx context.Context, eventType *EventType) error {
+	if err := e.validateSchemaString(eventType); err != nil {
+		return err
+	}
+
+	response, err := e.client.httpPOST(ctx, e.retryPolicy(), e.eventBaseURL(), eventType)
 	if err != nil {
 		return errors.Wrap(err, "unable to create event type")
 	}
@@ -153,7 +450,18 @@ func (e *EventAPI) Create(eventType *EventType) error {
 
 // Update updates an existing event type.
 func (e *EventAPI) Update(eventType *EventType) error {
-	response, err := e.client.httpPUT(e.backOff, e.eventURL(eventType.Name), eventType)
+	return e.UpdateContext(context.Background(), eventType)
+}
+
+// UpdateContext updates an existing event type. Provided context is used for
+// cancellation and may abort a request, or the retry sequence around it, while it is
+// in flight.
+func (e *EventAPI) UpdateContext(ctx context.Context, eventType *EventType) error {
+	if err := e.validateSchemaString(eventType); err != nil {
+		return err
+	}
+
+	response, err := e.client.httpPUT(ctx, e.retryPolicy(), e.eventURL(eventType.Name), eventType)
 	if err != nil {
 		return errors.Wrap(err, "unable to update event type")
 	}
@@ -173,7 +481,13 @@ func (e *EventAPI) Update(eventType *EventType) error {
 
 // Delete removes an event type.
 func (e *EventAPI) Delete(name string) error {
-	return e.client.httpDELETE(e.backOff, e.eventURL(name), "unable to delete event type")
+	return e.DeleteContext(context.Background(), name)
+}
+
+// DeleteContext removes an event type. Provided context is used for cancellation and
+// may abort a request, or the retry sequence around it, while it is in flight.
+func (e *EventAPI) DeleteContext(ctx context.Context, name string) error {
+	return e.client.httpDELETE(ctx, e.retryPolicy(), e.eventURL(name), "unable to delete event type")
 }
 
 func (e *EventAPI) eventURL(name string) string {
@@ -0,0 +1,169 @@
+package nakadi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BatchItemResponse describes the outcome of a single event within a batch publish.
+// Nakadi returns a list of these with 207 (Multi Status) when some, but not all,
+// events in a batch failed, and with 422 when all of them did.
+type BatchItemResponse struct {
+	EID              string `json:"eid,omitempty"`
+	PublishingStatus string `json:"publishing_status"`
+	Step             string `json:"step,omitempty"`
+	Detail           string `json:"detail,omitempty"`
+}
+
+// PublishOptions is a set of optional parameters used to configure a PublishAPI. Its
+// retry semantics mirror EventOptions.
+type PublishOptions struct {
+	// Whether or not Publish retries when a request fails. If set to false
+	// InitialRetryInterval, MaxRetryInterval, and MaxElapsedTime have no effect
+	// (default: false).
+	Retry bool
+	// The initial (minimal) retry interval used for the exponential backoff algorithm
+	// when retry is enabled.
+	InitialRetryInterval time.Duration
+	// MaxRetryInterval the maximum retry interval. Once the exponential backoff reaches
+	// this value the retry intervals remain constant.
+	MaxRetryInterval time.Duration
+	// MaxElapsedTime is the maximum time spent on retries when performing a request.
+	MaxElapsedTime time.Duration
+	// RetryAfterMax caps how long to sleep when Nakadi responds with a Retry-After
+	// header on a 429 or 503. See EventOptions.RetryAfterMax for the full semantics.
+	RetryAfterMax time.Duration
+	// OnRetry, if set, is invoked before every retry attempt. See EventOptions.OnRetry.
+	OnRetry func(attempt int, elapsed time.Duration, err error, nextInterval time.Duration)
+}
+
+func (o *PublishOptions) withDefaults() *PublishOptions {
+	var copyOptions PublishOptions
+	if o != nil {
+		copyOptions = *o
+	}
+	if copyOptions.InitialRetryInterval == 0 {
+		copyOptions.InitialRetryInterval = defaultInitialRetryInterval
+	}
+	if copyOptions.MaxRetryInterval == 0 {
+		copyOptions.MaxRetryInterval = defaultMaxRetryInterval
+	}
+	if copyOptions.MaxElapsedTime == 0 {
+		copyOptions.MaxElapsedTime = defaultMaxElapsedTime
+	}
+	return &copyOptions
+}
+
+// NewPublishAPI creates a new instance of a PublishAPI implementation which can be used
+// to publish events of a single event type to a specific Nakadi service. If validator
+// is not nil and was constructed with EventOptions.ValidateSchema enabled, every event
+// is checked against validator's cached, compiled JSON Schema before it is sent. The
+// last parameter is a struct containing only optional parameters. The options may be
+// nil.
+func NewPublishAPI(client *Client, eventTypeName string, validator *EventAPI, options *PublishOptions) *PublishAPI {
+	options = options.withDefaults()
+
+	backOff := backoffConfig{
+		retry:      options.Retry,
+		initial:    options.InitialRetryInterval,
+		max:        options.MaxRetryInterval,
+		maxElapsed: options.MaxElapsedTime}
+	return &PublishAPI{
+		client:        client,
+		eventTypeName: eventTypeName,
+		validator:     validator,
+		backOff:       backOff,
+		retryAfterMax: options.RetryAfterMax,
+		onRetry:       options.OnRetry,
+		stats:         &apiStats{byStatus: map[int]int64{}}}
+}
+
+// PublishAPI is a sub API that allows to publish events of a single event type to a
+// Nakadi instance.
+type PublishAPI struct {
+	client        *Client
+	eventTypeName string
+	validator     *EventAPI
+	backOff       backoffConfig
+	retryAfterMax time.Duration
+	onRetry       func(attempt int, elapsed time.Duration, err error, nextInterval time.Duration)
+	stats         *apiStats
+}
+
+// retryPolicy returns the retry policy used for requests issued by this PublishAPI.
+func (p *PublishAPI) retryPolicy() *retryPolicy {
+	p.stats.recordRequest()
+	return &retryPolicy{
+		backOff:       p.backOff.new(),
+		retryAfterMax: p.retryAfterMax,
+		onRetry:       p.onRetry,
+		stats:         p.stats}
+}
+
+// Stats returns the current request and retry counters for this PublishAPI.
+func (p *PublishAPI) Stats() Stats {
+	return p.stats.snapshot()
+}
+
+// Publish sends events to Nakadi.
+func (p *PublishAPI) Publish(events []interface{}) error {
+	return p.PublishContext(context.Background(), events)
+}
+
+// PublishContext sends events to Nakadi. If a validator was configured, every event is
+// validated against the event type's cached JSON Schema before anything is sent, and a
+// *ValidationError is returned on the first one that fails. Provided context is used
+// for cancellation and may abort a request, or the retry sequence around it, while it
+// is in flight.
+func (p *PublishAPI) PublishContext(ctx context.Context, events []interface{}) error {
+	if p.validator != nil {
+		for _, event := range events {
+			if err := p.validator.Validate(p.eventTypeName, event); err != nil {
+				return err
+			}
+		}
+	}
+
+	response, err := p.client.httpPOST(ctx, p.retryPolicy(), p.publishURL(), events)
+	if err != nil {
+		return errors.Wrap(err, "unable to publish events")
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusMultiStatus, http.StatusUnprocessableEntity:
+		return decodeBatchItemErrors(response)
+	default:
+		return decodeProblem(response, "unable to publish events")
+	}
+}
+
+// decodeBatchItemErrors reads the []BatchItemResponse body Nakadi sends on a 207 or 422
+// publish response and turns the failed items into a single error.
+func decodeBatchItemErrors(response *http.Response) error {
+	var items []BatchItemResponse
+	if err := json.NewDecoder(response.Body).Decode(&items); err != nil {
+		return errors.Wrap(err, "unable to decode response body")
+	}
+
+	var failures []string
+	for _, item := range items {
+		if item.PublishingStatus == "submitted" {
+			continue
+		}
+		failures = append(failures, fmt.Sprintf("%s (%s): %s", item.EID, item.Step, item.Detail))
+	}
+	return errors.Errorf("unable to publish events, %d event(s) failed: %s", len(failures), strings.Join(failures, "; "))
+}
+
+func (p *PublishAPI) publishURL() string {
+	return fmt.Sprintf("%s/event-types/%s/events", p.client.nakadiURL, p.eventTypeName)
+}